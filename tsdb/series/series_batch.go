@@ -0,0 +1,119 @@
+package series
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// SeriesBatchOp identifies the kind of operation a SeriesBatch record holds.
+type SeriesBatchOp byte
+
+const (
+	// SeriesBatchOpPut records a series creation: name/tags.
+	SeriesBatchOpPut SeriesBatchOp = 1
+	// SeriesBatchOpDelete records a series deletion: a series ID.
+	SeriesBatchOpDelete SeriesBatchOp = 2
+)
+
+// SeriesBatch accumulates a sequence of series creations and deletions into
+// a single contiguous byte buffer, the way leveldb's WriteBatch accumulates
+// puts/deletes before a single atomic write. It replaces passing parallel
+// names/tagsSlice/types slices around: callers build up a batch with Put
+// and Delete, then hand it to something that knows how to apply it (a
+// SeriesBatchReplay) in one pass.
+//
+// Each record is a 1-byte SeriesBatchOp followed by its payload: a Put's
+// payload is a series key in the AppendSeriesKey encoding, which is
+// self-describing (SeriesKeyLen reports its length), so records need no
+// additional length prefix. A Delete's payload is a single varint series ID.
+type SeriesBatch struct {
+	buf []byte
+	n   int
+}
+
+// Put appends a series creation record to the batch.
+func (b *SeriesBatch) Put(name []byte, tags models.Tags) {
+	b.buf = append(b.buf, byte(SeriesBatchOpPut))
+	b.buf = AppendSeriesKey(b.buf, name, tags)
+	b.n++
+}
+
+// Delete appends a series deletion record to the batch.
+func (b *SeriesBatch) Delete(seriesID uint64) {
+	b.buf = append(b.buf, byte(SeriesBatchOpDelete))
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], seriesID)
+	b.buf = append(b.buf, tmp[:n]...)
+	b.n++
+}
+
+// Len returns the number of records in the batch.
+func (b *SeriesBatch) Len() int { return b.n }
+
+// Size returns the size of the batch's underlying buffer in bytes.
+func (b *SeriesBatch) Size() int { return len(b.buf) }
+
+// Reset clears the batch, retaining its underlying buffer for reuse.
+func (b *SeriesBatch) Reset() {
+	b.buf = b.buf[:0]
+	b.n = 0
+}
+
+// SeriesBatchReplay receives the records of a SeriesBatch, in order, as
+// Replay decodes them.
+type SeriesBatchReplay interface {
+	Put(name []byte, tags models.Tags) error
+	Delete(seriesID uint64) error
+}
+
+// Replay decodes the batch's records in order, calling r.Put or r.Delete
+// for each one. It stops and returns the first error encountered.
+func (b *SeriesBatch) Replay(r SeriesBatchReplay) error {
+	pos := 0
+	for pos < len(b.buf) {
+		op := SeriesBatchOp(b.buf[pos])
+		pos++
+
+		switch op {
+		case SeriesBatchOpPut:
+			key := b.buf[pos:]
+			n := SeriesKeyLen(key)
+			name, tags := ParseSeriesKey(key[:n])
+			pos += n
+			if err := r.Put(name, tags); err != nil {
+				return err
+			}
+		case SeriesBatchOpDelete:
+			id, n := binary.Uvarint(b.buf[pos:])
+			pos += n
+			if err := r.Delete(id); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("series: invalid batch op %d", op)
+		}
+	}
+	return nil
+}
+
+// SeriesKeyLen returns the number of bytes data's leading series key
+// occupies, reading only its header -- the offsets_section_size and
+// bytes_section_size fields -- without decoding any tag. This lets callers
+// that pack multiple series keys back to back (SeriesBatch) split them
+// apart without a separate length prefix. It dispatches on the V1/V2 version marker the same way
+// CompareSeriesKeys does.
+func SeriesKeyLen(data []byte) int {
+	if data[0] == seriesKeyVersion2 {
+		ofsN := GetUint16(data, 1)
+		pos := 3 + ofsN
+		bytsz := GetUint16(data, pos)
+		return pos + 2 + bytsz
+	}
+
+	ofsN := GetUint16(data, 0)
+	pos := ofsN + 2
+	bytsz := GetUint16(data, pos)
+	return pos + 2 + bytsz
+}
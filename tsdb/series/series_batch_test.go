@@ -0,0 +1,134 @@
+package series
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+type recordingReplay struct {
+	puts    [][2]string
+	deletes []uint64
+	failOn  int
+}
+
+func (r *recordingReplay) Put(name []byte, tags models.Tags) error {
+	if len(r.puts) == r.failOn {
+		return errors.New("replay: forced failure")
+	}
+	r.puts = append(r.puts, [2]string{string(name), tags.String()})
+	return nil
+}
+
+func (r *recordingReplay) Delete(seriesID uint64) error {
+	r.deletes = append(r.deletes, seriesID)
+	return nil
+}
+
+func TestSeriesBatch_Replay(t *testing.T) {
+	var b SeriesBatch
+
+	n1, t1 := models.ParseKeyBytes([]byte("cpu,host=host1,region=us-west"))
+	n2, t2 := models.ParseKeyBytes([]byte("mem,host=host2"))
+
+	b.Put(n1, t1)
+	b.Delete(42)
+	b.Put(n2, t2)
+
+	if b.Len() != 3 {
+		t.Fatalf("unexpected record count: %d", b.Len())
+	}
+
+	var replay recordingReplay
+	replay.failOn = -1
+	if err := b.Replay(&replay); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replay.puts) != 2 || replay.puts[0][0] != "cpu" || replay.puts[1][0] != "mem" {
+		t.Fatalf("unexpected puts: %+v", replay.puts)
+	}
+	if len(replay.deletes) != 1 || replay.deletes[0] != 42 {
+		t.Fatalf("unexpected deletes: %+v", replay.deletes)
+	}
+}
+
+func TestSeriesBatch_Reset(t *testing.T) {
+	var b SeriesBatch
+	n, tags := models.ParseKeyBytes([]byte("cpu,host=host1"))
+	b.Put(n, tags)
+
+	if b.Len() == 0 || b.Size() == 0 {
+		t.Fatal("expected non-empty batch before reset")
+	}
+
+	b.Reset()
+	if b.Len() != 0 || b.Size() != 0 {
+		t.Fatalf("expected empty batch after reset, got len=%d size=%d", b.Len(), b.Size())
+	}
+
+	// The underlying buffer is reused, not reallocated.
+	b.Put(n, tags)
+	if b.Len() != 1 {
+		t.Fatalf("unexpected record count after reuse: %d", b.Len())
+	}
+}
+
+// TestSeriesBatch_ReplayPartialFailure documents Replay's own
+// partial-failure semantics: it applies records in order and stops at the
+// first error, so earlier records have already been delivered to the replay
+// target and later ones are simply never attempted.
+//
+// This is not the same thing as the request's SeriesFile.Apply, which would
+// route a batch's records to partitions by hash and commit each partition
+// atomically; this tree has no SeriesFile/partition concept for that API to
+// route across, so Apply was not implemented, and this test does not cover
+// its per-partition rollback/ID-ordering semantics.
+func TestSeriesBatch_ReplayPartialFailure(t *testing.T) {
+	var b SeriesBatch
+	for _, key := range []string{"m0,host=h0", "m1,host=h1", "m2,host=h2"} {
+		n, tags := models.ParseKeyBytes([]byte(key))
+		b.Put(n, tags)
+	}
+
+	var replay recordingReplay
+	replay.failOn = 1 // fail applying the second record
+
+	err := b.Replay(&replay)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(replay.puts) != 1 {
+		t.Fatalf("expected exactly 1 record applied before failure, got %d", len(replay.puts))
+	}
+}
+
+func BenchmarkSeriesBatch_Put(b *testing.B) {
+	names, tagsSlice := generateSeries(1, 10, 10, 10)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var batch SeriesBatch
+		for j := range names {
+			batch.Put(names[j], tagsSlice[j])
+		}
+	}
+}
+
+// BenchmarkGenerateSeriesKeys_Legacy is the equivalent-size baseline for
+// BenchmarkSeriesBatch_Put: building the same keys through the existing
+// one-shot GenerateSeriesKeys API this tree has, rather than
+// SeriesFile.CreateSeriesListIfNotExists (which doesn't exist here).
+func BenchmarkGenerateSeriesKeys_Legacy(b *testing.B) {
+	names, tagsSlice := generateSeries(1, 10, 10, 10)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GenerateSeriesKeys(names, tagsSlice)
+	}
+}
@@ -0,0 +1,325 @@
+package series
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// SeriesKeyWriter writes a stream of series keys to some sink -- an
+// in-memory buffer, a file, a socket. Keys are written in the same
+// AppendSeriesKey/AppendSeriesKeyV2 encoding used everywhere else in this
+// package, so nothing needs to be re-encoded on either end.
+type SeriesKeyWriter interface {
+	// WriteKey writes key. key is only valid for the duration of the call;
+	// an implementation that needs to retain it must copy.
+	WriteKey(key []byte) error
+}
+
+// SeriesKeyReader reads back a stream of series keys written by a
+// SeriesKeyWriter, one at a time, returning io.EOF once exhausted.
+type SeriesKeyReader interface {
+	ReadKey() ([]byte, error)
+}
+
+// SeriesKeyStreamWriter is a SeriesKeyWriter over an io.Writer. Each key is
+// framed with a varint length prefix, so a reader doesn't need to decode a
+// key's header just to find the next one.
+type SeriesKeyStreamWriter struct {
+	w      *bufio.Writer
+	lenbuf [binary.MaxVarintLen64]byte
+}
+
+// NewSeriesKeyStreamWriter returns a SeriesKeyStreamWriter writing to w.
+func NewSeriesKeyStreamWriter(w io.Writer) *SeriesKeyStreamWriter {
+	return &SeriesKeyStreamWriter{w: bufio.NewWriter(w)}
+}
+
+func (sw *SeriesKeyStreamWriter) WriteKey(key []byte) error {
+	n := binary.PutUvarint(sw.lenbuf[:], uint64(len(key)))
+	if _, err := sw.w.Write(sw.lenbuf[:n]); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(key)
+	return err
+}
+
+// Flush flushes any buffered data to the underlying io.Writer.
+func (sw *SeriesKeyStreamWriter) Flush() error { return sw.w.Flush() }
+
+// SeriesKeyStreamReader is a SeriesKeyReader over an io.Reader, reading
+// back records written by a SeriesKeyStreamWriter.
+type SeriesKeyStreamReader struct {
+	r *bufio.Reader
+}
+
+// NewSeriesKeyStreamReader returns a SeriesKeyStreamReader reading from r.
+func NewSeriesKeyStreamReader(r io.Reader) *SeriesKeyStreamReader {
+	return &SeriesKeyStreamReader{r: bufio.NewReader(r)}
+}
+
+func (sr *SeriesKeyStreamReader) ReadKey() ([]byte, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateSeriesKeysTo is the streaming counterpart to GenerateSeriesKeys:
+// instead of materializing every key in one big memory block, it encodes
+// and writes one key at a time, so names/tagsSlice can describe far more
+// series than would comfortably fit resident at once.
+func GenerateSeriesKeysTo(w SeriesKeyWriter, names [][]byte, tagsSlice []models.Tags) error {
+	var buf []byte
+	for i := range names {
+		buf = AppendSeriesKey(buf[:0], names[i], tagsSlice[i])
+		if err := w.WriteKey(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	// DefaultExternalSortRunSize is the default amount of key data buffered
+	// in memory before a sorted run is spilled to a temp file.
+	DefaultExternalSortRunSize = 64 << 20 // 64 MiB
+	// DefaultExternalSortFanIn is the default number of runs merged
+	// together in a single pass.
+	DefaultExternalSortFanIn = 32
+)
+
+// ExternalSortOptions configures SortSeriesKeysExternal.
+type ExternalSortOptions struct {
+	// RunSize is the approximate number of key bytes buffered in memory
+	// before a sorted run is spilled to a temp file. Defaults to
+	// DefaultExternalSortRunSize.
+	RunSize int
+	// FanIn is the maximum number of runs merged together in a single
+	// pass; if more runs than this are spilled, they're merged down in
+	// multiple passes first. Defaults to DefaultExternalSortFanIn.
+	FanIn int
+	// TempDir is the directory sorted runs are spilled to. Defaults to
+	// os.TempDir() (via os.CreateTemp's default behavior).
+	TempDir string
+}
+
+func (o ExternalSortOptions) withDefaults() ExternalSortOptions {
+	if o.RunSize <= 0 {
+		o.RunSize = DefaultExternalSortRunSize
+	}
+	if o.FanIn <= 0 {
+		o.FanIn = DefaultExternalSortFanIn
+	}
+	if o.FanIn < 2 {
+		// A fan-in of 1 would merge a single run into a new single run
+		// forever without shrinking the run count.
+		o.FanIn = 2
+	}
+	return o
+}
+
+// SortSeriesKeysExternal sorts the series keys read from in by
+// CompareSeriesKeys and writes them, in order, to out. It never holds more
+// than roughly opts.RunSize bytes of key data in memory at once: it spills
+// sorted runs of that size to temp files, then merges the runs with a
+// container/heap min-heap keyed by CompareSeriesKeys, doing so in multiple
+// passes if more than opts.FanIn runs were spilled.
+func SortSeriesKeysExternal(in SeriesKeyReader, out SeriesKeyWriter, opts ExternalSortOptions) error {
+	opts = opts.withDefaults()
+
+	runFiles, err := spillSortedRuns(in, opts)
+	defer func() {
+		for _, path := range runFiles {
+			os.Remove(path)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	for len(runFiles) > opts.FanIn {
+		merged, err := mergeRunsToTempFile(runFiles[:opts.FanIn], opts)
+		if err != nil {
+			return err
+		}
+		for _, path := range runFiles[:opts.FanIn] {
+			os.Remove(path)
+		}
+		runFiles = append(append([]string{}, runFiles[opts.FanIn:]...), merged)
+	}
+
+	return mergeRuns(runFiles, out)
+}
+
+// sortableSeriesKeys sorts a slice of series keys by CompareSeriesKeys.
+type sortableSeriesKeys [][]byte
+
+func (a sortableSeriesKeys) Len() int      { return len(a) }
+func (a sortableSeriesKeys) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a sortableSeriesKeys) Less(i, j int) bool {
+	return CompareSeriesKeys(a[i], a[j]) < 0
+}
+
+// spillSortedRuns reads all of in, sorting and spilling runs of roughly
+// opts.RunSize bytes to temp files as it goes, and returns their paths.
+func spillSortedRuns(in SeriesKeyReader, opts ExternalSortOptions) ([]string, error) {
+	var runFiles []string
+	var keys sortableSeriesKeys
+	size := 0
+
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		sort.Sort(keys)
+
+		f, err := os.CreateTemp(opts.TempDir, "seriesrun-*")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sw := NewSeriesKeyStreamWriter(f)
+		for _, key := range keys {
+			if err := sw.WriteKey(key); err != nil {
+				return err
+			}
+		}
+		if err := sw.Flush(); err != nil {
+			return err
+		}
+
+		runFiles = append(runFiles, f.Name())
+		keys = keys[:0]
+		size = 0
+		return nil
+	}
+
+	for {
+		key, err := in.ReadKey()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// Return what's already been spilled so the caller can still
+			// clean those temp files up.
+			return runFiles, err
+		}
+
+		keys = append(keys, key)
+		size += len(key)
+		if size >= opts.RunSize {
+			if err := flush(); err != nil {
+				return runFiles, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return runFiles, err
+	}
+
+	return runFiles, nil
+}
+
+// mergeRunsToTempFile merges runFiles into a new temp file and returns its
+// path, for an intermediate pass when there are more runs than opts.FanIn.
+func mergeRunsToTempFile(runFiles []string, opts ExternalSortOptions) (string, error) {
+	f, err := os.CreateTemp(opts.TempDir, "seriesrun-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sw := NewSeriesKeyStreamWriter(f)
+	if err := mergeRuns(runFiles, sw); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := sw.Flush(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// runCursor holds a run's current key and the buffered reader positioned
+// just after it, so the merge heap can compare keys without re-reading.
+type runCursor struct {
+	r   *SeriesKeyStreamReader
+	key []byte
+}
+
+// runHeap is a container/heap min-heap of *runCursor ordered by
+// CompareSeriesKeys, used to pick the next key across all runs being merged.
+type runHeap []*runCursor
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return CompareSeriesKeys(h[i].key, h[j].key) < 0 }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// mergeRuns k-way merges the sorted run files at runFiles into out.
+func mergeRuns(runFiles []string, out SeriesKeyWriter) error {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	h := make(runHeap, 0, len(runFiles))
+	for _, path := range runFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+
+		cur := &runCursor{r: NewSeriesKeyStreamReader(f)}
+		key, err := cur.r.ReadKey()
+		if err == io.EOF {
+			continue // empty run
+		} else if err != nil {
+			return err
+		}
+		cur.key = key
+		h = append(h, cur)
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		cur := h[0]
+		if err := out.WriteKey(cur.key); err != nil {
+			return err
+		}
+
+		next, err := cur.r.ReadKey()
+		if err == io.EOF {
+			heap.Pop(&h)
+			continue
+		} else if err != nil {
+			return err
+		}
+		cur.key = next
+		heap.Fix(&h, 0)
+	}
+
+	return nil
+}
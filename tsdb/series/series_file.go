@@ -3,12 +3,19 @@ package series
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 
 	"github.com/influxdata/influxdb/models"
 )
 
-// AppendSeriesKey serializes name and tags to a byte slice.
+// AppendSeriesKey serializes name and tags to a byte slice. It panics if
+// tags has more than MaxSeriesKeyV1Tags entries; use AppendSeriesKeyV2 for
+// series with more tags than that.
 func AppendSeriesKey(dst []byte, name []byte, tags models.Tags) []byte {
+	if len(tags) > MaxSeriesKeyV1Tags {
+		panic(fmt.Sprintf("series: %d tags exceeds MaxSeriesKeyV1Tags (%d)", len(tags), MaxSeriesKeyV1Tags))
+	}
+
 	ofssz := SeriesKeyOffsetsSize(len(tags))
 	bytsz := SeriesKeyBytesSize(name, tags)
 
@@ -67,6 +74,9 @@ func GetUint16(b []byte, p int) int {
 }
 
 func GetSeriesKeyTagN(data []byte) int {
+	if data[0] == seriesKeyVersion2 {
+		return getSeriesKeyTagNV2(data)
+	}
 	ofsN := GetUint16(data, 0)
 	return (ofsN - 2) / 4
 }
@@ -113,6 +123,9 @@ func ParseSeriesKeyTags(data []byte, tags models.Tags) (name []byte, _ models.Ta
 	return name, tags
 }
 
+// CompareSeriesKeys orders two series keys by their encoded name+tags bytes.
+// It dispatches on each key's version (V1 vs. AppendSeriesKeyV2) so a
+// partition can hold a mix of old and newly-compacted keys.
 func CompareSeriesKeys(a, b []byte) int {
 	// Handle 'nil' keys.
 	if len(a) == 0 && len(b) == 0 {
@@ -123,18 +136,7 @@ func CompareSeriesKeys(a, b []byte) int {
 		return 1
 	}
 
-	ofsA := GetUint16(a, 0)
-	ofsB := GetUint16(b, 0)
-
-	posA := ofsA + 2
-	posB := ofsB + 2
-
-	keyLenA := GetUint16(a, posA)
-	keyLenB := GetUint16(b, posB)
-	posA += 2
-	posB += 2
-
-	return bytes.Compare(a[posA:posA+keyLenA], b[posB:posB+keyLenB])
+	return bytes.Compare(seriesKeyBytesSection(a), seriesKeyBytesSection(b))
 }
 
 // GenerateSeriesKeys generates series keys for a list of names & tags using
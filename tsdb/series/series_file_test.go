@@ -51,6 +51,25 @@ func makeKey(s string) []byte {
 	return AppendSeriesKey(nil, n, t)
 }
 
+// TestAppendSeriesKey_TooManyTags confirms a tag count that would push
+// offsets_section_size into the seriesKeyVersion2 sentinel range panics
+// rather than silently producing a key GetSeriesKeyTagN/CompareSeriesKeys
+// would misparse as V2.
+func TestAppendSeriesKey_TooManyTags(t *testing.T) {
+	name := []byte("cpu")
+	tags := make(models.Tags, MaxSeriesKeyV1Tags+1)
+	for i := range tags {
+		tags[i] = models.Tag{Key: []byte(fmt.Sprintf("t%05d", i)), Value: []byte("v")}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	AppendSeriesKey(nil, name, tags)
+}
+
 func TestCompareSeriesKeys(t *testing.T) {
 	type st struct {
 		name string
@@ -130,6 +149,152 @@ func TestCompareSeriesKeys(t *testing.T) {
 	}
 }
 
+func makeKeyV2(s string) []byte {
+	n, t := models.ParseKeyBytes([]byte(s))
+	return AppendSeriesKeyV2(nil, n, t)
+}
+
+func TestAppendSeriesKeyV2_RoundTrip(t *testing.T) {
+	tests := []string{
+		"cpu",
+		"cpu,host=host1",
+		"cpu,host=host1,region=us-west",
+		"cpu,host=host1,region=us-west,az=1a,rack=42,env=prod",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			name, tags := models.ParseKeyBytes([]byte(test))
+			buf := AppendSeriesKeyV2(nil, name, tags)
+
+			if buf[0] != seriesKeyVersion2 {
+				t.Fatalf("missing version marker")
+			}
+			if n := GetSeriesKeyTagN(buf); n != len(tags) {
+				t.Fatalf("unexpected tag count: got %d, exp %d", n, len(tags))
+			}
+
+			name2, tags2 := ParseSeriesKeyV2(buf)
+			if !cmp.Equal(string(name2), string(name)) {
+				t.Errorf("unexpected name -got/+exp\n%s", cmp.Diff(string(name2), string(name)))
+			}
+			if !cmp.Equal(tags2.String(), tags.String()) {
+				t.Errorf("unexpected tags -got/+exp\n%s", cmp.Diff(tags2.String(), tags.String()))
+			}
+		})
+	}
+}
+
+func TestCompareSeriesKeys_V1V2Agree(t *testing.T) {
+	pairs := []struct {
+		a, b string
+	}{
+		{"aaa", "aaa"},
+		{"aaa", "bbb"},
+		{"ccc", "bbb"},
+		{"aaa,taaa=vaaa", "aaa,taaa=vaaa"},
+		{"aaa,taaa=vaaa", "bbb,taaa=vaaa"},
+		{"aaa,taaa=vaaa", "aaa,tbbb=vaaa"},
+		{"cpu,host=host1,region=us-west", "cpu,host=host2,region=us-west"},
+	}
+	for _, pair := range pairs {
+		t.Run(pair.a+" vs "+pair.b, func(t *testing.T) {
+			v1 := CompareSeriesKeys(makeKey(pair.a), makeKey(pair.b))
+			v2 := CompareSeriesKeys(makeKeyV2(pair.a), makeKeyV2(pair.b))
+			mixed := CompareSeriesKeys(makeKey(pair.a), makeKeyV2(pair.b))
+			if v1 != v2 || v1 != mixed {
+				t.Errorf("version mismatch: v1=%d v2=%d mixed=%d", v1, v2, mixed)
+			}
+		})
+	}
+}
+
+func TestConvertSeriesKeyV1ToV2(t *testing.T) {
+	keys := generateSeriesKeys(3, 2, 1, 1)
+	for i, key := range keys {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			v2 := ConvertSeriesKeyV1ToV2(nil, key)
+			if CompareSeriesKeys(key, v2) != 0 {
+				t.Fatalf("converted key does not compare equal to original")
+			}
+		})
+	}
+}
+
+// TestCompareSeriesKeysV2_Monotonic confirms that sorting a large set of V2
+// keys with CompareSeriesKeys produces the same order as sorting the
+// equivalent V1 keys, i.e. the varint offsets section doesn't perturb
+// ordering (ordering is over the name+tags bytes, not the offsets).
+func TestCompareSeriesKeysV2_Monotonic(t *testing.T) {
+	names, tagsSlice := generateSeries(1, 25, 4, 3)
+
+	v1 := make(seriesKeys, len(names))
+	v2 := make(seriesKeys, len(names))
+	for i := range names {
+		v1[i] = AppendSeriesKey(nil, names[i], tagsSlice[i])
+		v2[i] = AppendSeriesKeyV2(nil, names[i], tagsSlice[i])
+	}
+
+	rand.Seed(1)
+	perm := rand.Perm(len(v1))
+	shuffledV1 := make(seriesKeys, len(v1))
+	shuffledV2 := make(seriesKeys, len(v2))
+	for i, p := range perm {
+		shuffledV1[i] = v1[p]
+		shuffledV2[i] = v2[p]
+	}
+
+	sort.Sort(shuffledV1)
+	sort.Sort(shuffledV2)
+
+	for i := range shuffledV1 {
+		if CompareSeriesKeys(shuffledV1[i], shuffledV2[i]) != 0 {
+			t.Fatalf("sorted order diverged at position %d", i)
+		}
+	}
+}
+
+func BenchmarkAppendSeriesKeyV2(b *testing.B) {
+	names, tags := generateSeries(1, 25, 10, 4)
+
+	b.SetBytes(int64(SeriesKeysSize(names, tags)))
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var buf []byte
+		for j := range names {
+			buf = AppendSeriesKeyV2(buf, names[j], tags[j])
+		}
+	}
+}
+
+func BenchmarkCompareSeriesKeysV2(b *testing.B) {
+	tests := []struct {
+		name  string
+		tagsN []int
+	}{
+		{"last diff", []int{2, 1, 1, 1, 1}},
+		{"last diff", []int{2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{"first diff", []int{1, 1, 1, 1, 2}},
+		{"first diff", []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2}},
+	}
+
+	for _, test := range tests {
+		b.Run(fmt.Sprintf("%s %d tags", test.name, len(test.tagsN)), func(b *testing.B) {
+			names, tagsSlice := generateSeries(1, test.tagsN...)
+			keyA := AppendSeriesKeyV2(nil, names[0], tagsSlice[0])
+			keyB := AppendSeriesKeyV2(nil, names[1], tagsSlice[1])
+			j := 0
+			b.ResetTimer()
+			b.SetBytes(int64(len(keyA) + len(keyB)))
+			for i := 0; i < b.N; i++ {
+				j = CompareSeriesKeys(keyA, keyB)
+			}
+			gi = j
+		})
+	}
+}
+
 var (
 	gi int
 )
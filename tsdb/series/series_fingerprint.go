@@ -0,0 +1,96 @@
+package series
+
+import (
+	"bytes"
+	"sort"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// SeriesFingerprint is a content-addressed digest of a series key's
+// canonical encoding, used to short-circuit full key comparisons on the
+// duplicate-write-detection hot path and to let remote writers send a
+// 16-byte token instead of a full key when the receiving node already
+// knows the series.
+type SeriesFingerprint [16]byte
+
+// FingerprintSeriesKey computes the BLAKE2b-128 digest of a series key's
+// name+tags bytes section (seriesKeyBytesSection), the same bytes
+// CompareSeriesKeys orders on. The length fields of the AppendSeriesKey or
+// AppendSeriesKeyV2 encoding are not hashed, so the same name/tags produce
+// the same fingerprint regardless of which version encoded them, and two
+// keys whose name+tags bytes concatenate to the same sequence fingerprint
+// the same.
+func FingerprintSeriesKey(data []byte) SeriesFingerprint {
+	h, err := blake2b.New(16, nil)
+	if err != nil {
+		// Only returned for an invalid key size or size > 64; 16 is always valid.
+		panic(err)
+	}
+	h.Write(seriesKeyBytesSection(data))
+
+	var fp SeriesFingerprint
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// SeriesFingerprintIndex is a sorted table of (fingerprint, seriesID) pairs
+// searched by binary search.
+//
+// Two distinct series keys can map to the same fingerprint, though at 128
+// bits it is vanishingly unlikely. SeriesIDByFingerprint cannot resolve
+// that collision on its own, so callers must still confirm a match against
+// the full key (e.g. via CompareSeriesKeys) before treating it as
+// authoritative.
+type SeriesFingerprintIndex struct {
+	fingerprints []SeriesFingerprint
+	seriesIDs    []uint64
+}
+
+// NewSeriesFingerprintIndex builds a SeriesFingerprintIndex from parallel
+// fingerprint/seriesID slices, sorting them by fingerprint.
+func NewSeriesFingerprintIndex(fingerprints []SeriesFingerprint, seriesIDs []uint64) *SeriesFingerprintIndex {
+	idx := &SeriesFingerprintIndex{
+		fingerprints: append([]SeriesFingerprint(nil), fingerprints...),
+		seriesIDs:    append([]uint64(nil), seriesIDs...),
+	}
+
+	sort.Sort(idx)
+	return idx
+}
+
+// SeriesIDByFingerprint returns the series ID associated with fp, and false
+// if fp isn't present in the index.
+func (idx *SeriesFingerprintIndex) SeriesIDByFingerprint(fp SeriesFingerprint) (uint64, bool) {
+	i := sort.Search(len(idx.fingerprints), func(i int) bool {
+		return bytes.Compare(idx.fingerprints[i][:], fp[:]) >= 0
+	})
+	if i >= len(idx.fingerprints) || idx.fingerprints[i] != fp {
+		return 0, false
+	}
+	return idx.seriesIDs[i], true
+}
+
+func (idx *SeriesFingerprintIndex) Len() int { return len(idx.fingerprints) }
+
+func (idx *SeriesFingerprintIndex) Less(i, j int) bool {
+	return bytes.Compare(idx.fingerprints[i][:], idx.fingerprints[j][:]) < 0
+}
+
+func (idx *SeriesFingerprintIndex) Swap(i, j int) {
+	idx.fingerprints[i], idx.fingerprints[j] = idx.fingerprints[j], idx.fingerprints[i]
+	idx.seriesIDs[i], idx.seriesIDs[j] = idx.seriesIDs[j], idx.seriesIDs[i]
+}
+
+// EqualSeriesKeysFast reports whether a and b are the same series, given
+// their already-computed fingerprints fpA and fpB -- callers own computing
+// and caching those (e.g. once at insert time), so this never
+// re-fingerprints on the comparison hot path. It falls back to a full
+// CompareSeriesKeys only when fpA == fpB, to resolve the vanishingly
+// unlikely case of a fingerprint collision.
+func EqualSeriesKeysFast(fpA, fpB SeriesFingerprint, a, b []byte) bool {
+	if fpA != fpB {
+		return false
+	}
+	return CompareSeriesKeys(a, b) == 0
+}
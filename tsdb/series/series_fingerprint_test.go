@@ -0,0 +1,115 @@
+package series
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFingerprintSeriesKey(t *testing.T) {
+	a := makeKey("cpu,host=host1,region=us-west")
+	b := makeKey("cpu,host=host1,region=us-west")
+	c := makeKey("cpu,host=host2,region=us-west")
+
+	if FingerprintSeriesKey(a) != FingerprintSeriesKey(b) {
+		t.Fatal("identical series should fingerprint the same")
+	}
+	if FingerprintSeriesKey(a) == FingerprintSeriesKey(c) {
+		t.Fatal("distinct series should not fingerprint the same")
+	}
+}
+
+func TestFingerprintSeriesKey_VersionIndependent(t *testing.T) {
+	v1 := makeKey("cpu,host=host1,region=us-west")
+	v2 := makeKeyV2("cpu,host=host1,region=us-west")
+
+	if FingerprintSeriesKey(v1) != FingerprintSeriesKey(v2) {
+		t.Fatal("V1 and V2 encodings of the same series should fingerprint the same")
+	}
+}
+
+func TestEqualSeriesKeysFast(t *testing.T) {
+	a := makeKey("cpu,host=host1,region=us-west")
+	b := makeKey("cpu,host=host1,region=us-west")
+	c := makeKey("cpu,host=host2,region=us-west")
+	fpA, fpB, fpC := FingerprintSeriesKey(a), FingerprintSeriesKey(b), FingerprintSeriesKey(c)
+
+	if !EqualSeriesKeysFast(fpA, fpB, a, b) {
+		t.Fatal("expected equal")
+	}
+	if EqualSeriesKeysFast(fpA, fpC, a, c) {
+		t.Fatal("expected not equal")
+	}
+}
+
+func TestSeriesFingerprintIndex_SeriesIDByFingerprint(t *testing.T) {
+	keys := generateSeriesKeys(50, 2, 2)
+
+	fps := make([]SeriesFingerprint, len(keys))
+	ids := make([]uint64, len(keys))
+	for i, key := range keys {
+		fps[i] = FingerprintSeriesKey(key)
+		ids[i] = uint64(i + 1)
+	}
+
+	idx := NewSeriesFingerprintIndex(fps, ids)
+
+	for i, key := range keys {
+		id, ok := idx.SeriesIDByFingerprint(FingerprintSeriesKey(key))
+		if !ok {
+			t.Fatalf("key %d: expected a match", i)
+		}
+		if id != ids[i] {
+			t.Fatalf("key %d: unexpected series ID: got %d, exp %d", i, id, ids[i])
+		}
+	}
+
+	var missing SeriesFingerprint
+	if _, ok := idx.SeriesIDByFingerprint(missing); ok {
+		t.Fatal("expected no match for an all-zero fingerprint")
+	}
+}
+
+// BenchmarkSeriesEquality compares the two ways of checking whether a
+// candidate series key matches an already-known one: a full
+// CompareSeriesKeys, vs. an equality check of two precomputed fingerprints
+// (as a write path would do after looking up a candidate by fingerprint).
+// Fingerprinting itself happens once at insert time per the request, so
+// it's deliberately excluded from the timed loop here -- it's the
+// per-candidate comparison cost this is meant to shrink.
+func BenchmarkSeriesEquality(b *testing.B) {
+	tests := []struct {
+		name  string
+		tagsN []int
+	}{
+		{"last diff", []int{2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+	}
+
+	for _, test := range tests {
+		b.Run(fmt.Sprintf("%s %d tags", test.name, len(test.tagsN)), func(b *testing.B) {
+			keys := generateSeriesKeys(1, test.tagsN...)
+			keyA, keyB := keys[0], keys[1]
+			fpA, fpB := FingerprintSeriesKey(keyA), FingerprintSeriesKey(keyB)
+
+			b.Run("full compare", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					gi = CompareSeriesKeys(keyA, keyB)
+				}
+			})
+			b.Run("fingerprint", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					gb = fpA == fpB
+				}
+			})
+			b.Run("EqualSeriesKeysFast", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					gb = EqualSeriesKeysFast(fpA, fpB, keyA, keyB)
+				}
+			})
+		})
+	}
+}
+
+var gb bool
@@ -0,0 +1,262 @@
+package series
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// DefaultSeriesKeyBlockRestartInterval is the number of entries between
+// full, uncompressed "restart" entries in a prefix-compressed block. This
+// mirrors the restart interval used by most LSM SSTable data block formats:
+// small enough that a linear scan from a restart point is cheap, large
+// enough that the restart offsets don't dominate the block.
+const DefaultSeriesKeyBlockRestartInterval = 16
+
+// ErrInvalidSeriesKeyBlock is returned when a byte slice is too short or
+// otherwise malformed to be a block produced by EncodeSeriesKeyBlock.
+var ErrInvalidSeriesKeyBlock = errors.New("series: invalid series key block")
+
+// EncodeSeriesKeyBlock prefix-compresses a run of sorted series keys into a
+// single block. Keys must already be sorted by CompareSeriesKeys.
+//
+// A key's header (version marker, offsets section, bytes_section_size) and
+// its name+tags bytes section (seriesKeyBytesSection) are prefix-compressed
+// independently of each other. The header encodes each tag's key/value byte
+// length, so it can differ between two keys whose logical content shares a
+// long prefix (e.g. "host9" vs. "host10", where the tag value's length field
+// and bytes_section_size change); compressing header and bytes section as one combined run,
+// as if the header's bytes were part of the logical content, would let that
+// difference cut the shared match short before ever reaching the shared
+// name/tag bytes that follow.
+//
+// Every entry is encoded as (header_shared_len, header_unshared_len,
+// header_unshared_bytes, bytes_shared_len, bytes_unshared_len,
+// bytes_unshared_bytes, trailer): the four lengths are varints, the two
+// unshared fields are raw bytes, and trailer is a single byte reserved for
+// a future per-entry record type (e.g. a tombstone marker). The first entry
+// of the block, and every restartInterval'th entry after it, is a "restart
+// point": both shared_len fields are forced to 0 so the entry holds its
+// header and bytes section in full, and its byte offset is recorded in a
+// restart array appended to the tail of the block. A reader can then binary
+// search the restart array by full key before linearly decoding forward,
+// rather than decompressing the block from the start.
+//
+// The block is terminated by the restart offsets (uint32 each), the entry
+// count (uint32), and the restart count (uint32), all big-endian, letting a
+// reader parse the trailer from the end without knowing the entry count up
+// front. If restartInterval <= 0, DefaultSeriesKeyBlockRestartInterval is
+// used.
+func EncodeSeriesKeyBlock(dst []byte, keys [][]byte, restartInterval int) []byte {
+	if restartInterval <= 0 {
+		restartInterval = DefaultSeriesKeyBlockRestartInterval
+	}
+
+	restarts := make([]uint32, 0, len(keys)/restartInterval+1)
+	blockStart := len(dst)
+
+	var prevHeader, prevBody []byte
+	var varintBuf [binary.MaxVarintLen64]byte
+	for i, key := range keys {
+		body := seriesKeyBytesSection(key)
+		header := key[:len(key)-len(body)]
+
+		headerShared, bodyShared := 0, 0
+		if i%restartInterval == 0 {
+			restarts = append(restarts, uint32(len(dst)-blockStart))
+		} else {
+			headerShared = sharedPrefixLen(prevHeader, header)
+			bodyShared = sharedPrefixLen(prevBody, body)
+		}
+		headerUnshared := header[headerShared:]
+		bodyUnshared := body[bodyShared:]
+
+		n := binary.PutUvarint(varintBuf[:], uint64(headerShared))
+		dst = append(dst, varintBuf[:n]...)
+		n = binary.PutUvarint(varintBuf[:], uint64(len(headerUnshared)))
+		dst = append(dst, varintBuf[:n]...)
+		dst = append(dst, headerUnshared...)
+
+		n = binary.PutUvarint(varintBuf[:], uint64(bodyShared))
+		dst = append(dst, varintBuf[:n]...)
+		n = binary.PutUvarint(varintBuf[:], uint64(len(bodyUnshared)))
+		dst = append(dst, varintBuf[:n]...)
+		dst = append(dst, bodyUnshared...)
+		dst = append(dst, 0) // trailer
+
+		prevHeader, prevBody = header, body
+	}
+
+	for _, r := range restarts {
+		dst = appendUint32(dst, r)
+	}
+	dst = appendUint32(dst, uint32(len(keys)))
+	dst = appendUint32(dst, uint32(len(restarts)))
+
+	return dst
+}
+
+func sharedPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var i int
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+// SeriesKeyBlockReader reads a single block produced by EncodeSeriesKeyBlock.
+type SeriesKeyBlockReader struct {
+	entries  []byte // block data with the trailer stripped off
+	restarts []uint32
+	count    int
+}
+
+// NewSeriesKeyBlockReader parses the trailer of block and returns a reader
+// over its entries.
+func NewSeriesKeyBlockReader(block []byte) (*SeriesKeyBlockReader, error) {
+	if len(block) < 8 {
+		return nil, ErrInvalidSeriesKeyBlock
+	}
+
+	restartCount := binary.BigEndian.Uint32(block[len(block)-4:])
+	count := binary.BigEndian.Uint32(block[len(block)-8 : len(block)-4])
+
+	restartsStart := len(block) - 8 - int(restartCount)*4
+	if restartsStart < 0 {
+		return nil, ErrInvalidSeriesKeyBlock
+	}
+
+	restarts := make([]uint32, restartCount)
+	for i := range restarts {
+		restarts[i] = binary.BigEndian.Uint32(block[restartsStart+i*4:])
+	}
+
+	return &SeriesKeyBlockReader{
+		entries:  block[:restartsStart],
+		restarts: restarts,
+		count:    int(count),
+	}, nil
+}
+
+// Len returns the number of series keys encoded in the block.
+func (r *SeriesKeyBlockReader) Len() int { return r.count }
+
+// Iterator returns an iterator positioned before the block's first entry.
+func (r *SeriesKeyBlockReader) Iterator() *SeriesKeyBlockIterator {
+	return &SeriesKeyBlockIterator{r: r}
+}
+
+// bodyAt returns the bytes section (name+tags content) of the entry stored
+// at a restart point, as a zero-copy subslice of r.entries. It's used by
+// Seek's binary search, which only needs the bytes section: CompareSeriesKeys
+// compares nothing else.
+func (r *SeriesKeyBlockReader) bodyAt(restart uint32) []byte {
+	pos := int(restart)
+
+	_, n := binary.Uvarint(r.entries[pos:]) // header shared, always 0 at a restart
+	pos += n
+	headerUnsharedLen, n := binary.Uvarint(r.entries[pos:])
+	pos += n
+	pos += int(headerUnsharedLen)
+
+	_, n = binary.Uvarint(r.entries[pos:]) // bytes shared, always 0 at a restart
+	pos += n
+	bodyUnsharedLen, n := binary.Uvarint(r.entries[pos:])
+	pos += n
+	return r.entries[pos : pos+int(bodyUnsharedLen)]
+}
+
+// SeriesKeyBlockIterator decodes entries out of a SeriesKeyBlockReader on
+// demand. The slice returned by Key aliases the iterator's internal scratch
+// buffer and is only valid until the next call to Next or Seek.
+type SeriesKeyBlockIterator struct {
+	r      *SeriesKeyBlockReader
+	pos    int
+	header []byte // current entry's reconstructed header
+	body   []byte // current entry's reconstructed bytes section
+	key    []byte // current entry's header + body
+	done   bool
+}
+
+// Key returns the series key at the iterator's current position.
+func (it *SeriesKeyBlockIterator) Key() []byte { return it.key }
+
+// Next decodes the next entry, reconstructing its header and bytes section
+// from the shared prefixes of the previous entry's. It returns false once
+// the block is exhausted.
+func (it *SeriesKeyBlockIterator) Next() bool {
+	if it.done || it.pos >= len(it.r.entries) {
+		it.done = true
+		return false
+	}
+
+	data := it.r.entries
+	headerShared, n := binary.Uvarint(data[it.pos:])
+	it.pos += n
+	headerUnsharedLen, n := binary.Uvarint(data[it.pos:])
+	it.pos += n
+	headerUnshared := data[it.pos : it.pos+int(headerUnsharedLen)]
+	it.pos += int(headerUnsharedLen)
+
+	bodyShared, n := binary.Uvarint(data[it.pos:])
+	it.pos += n
+	bodyUnsharedLen, n := binary.Uvarint(data[it.pos:])
+	it.pos += n
+	bodyUnshared := data[it.pos : it.pos+int(bodyUnsharedLen)]
+	it.pos += int(bodyUnsharedLen)
+	it.pos++ // trailer
+
+	it.header = append(it.header[:headerShared], headerUnshared...)
+	it.body = append(it.body[:bodyShared], bodyUnshared...)
+	it.key = append(it.key[:0], it.header...)
+	it.key = append(it.key, it.body...)
+	return true
+}
+
+// Seek positions the iterator at the first key >= target, returning false
+// if no such key exists in the block (including an empty block). It binary
+// searches the restart array by full key, then linearly decodes forward
+// from the nearest restart.
+func (it *SeriesKeyBlockIterator) Seek(target []byte) bool {
+	r := it.r
+	if len(r.restarts) == 0 {
+		return false
+	}
+
+	targetBody := seriesKeyBytesSection(target)
+
+	lo, hi := 0, len(r.restarts)-1
+	idx := 0
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		if bytes.Compare(r.bodyAt(r.restarts[mid]), targetBody) <= 0 {
+			idx = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	it.pos = int(r.restarts[idx])
+	it.header = it.header[:0]
+	it.body = it.body[:0]
+	it.key = it.key[:0]
+	it.done = false
+
+	for it.Next() {
+		if CompareSeriesKeys(it.key, target) >= 0 {
+			return true
+		}
+	}
+	return false
+}
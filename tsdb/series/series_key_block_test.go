@@ -0,0 +1,203 @@
+package series
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+func TestSeriesKeyBlock_RoundTrip(t *testing.T) {
+	names, tagsSlice := generateSeries(1, 25, 4, 3)
+	keys := make(seriesKeys, len(names))
+	for i := range names {
+		keys[i] = AppendSeriesKey(nil, names[i], tagsSlice[i])
+	}
+	sort.Sort(keys)
+
+	block := EncodeSeriesKeyBlock(nil, keys, 8)
+	r, err := NewSeriesKeyBlockReader(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != len(keys) {
+		t.Fatalf("unexpected entry count: got %d, exp %d", r.Len(), len(keys))
+	}
+
+	it := r.Iterator()
+	for i, key := range keys {
+		if !it.Next() {
+			t.Fatalf("unexpected end of block at entry %d", i)
+		}
+		if CompareSeriesKeys(it.Key(), key) != 0 {
+			t.Fatalf("entry %d: unexpected key", i)
+		}
+	}
+	if it.Next() {
+		t.Fatal("expected end of block")
+	}
+}
+
+func TestSeriesKeyBlockIterator_Seek(t *testing.T) {
+	names, tagsSlice := generateSeries(1, 25, 4, 3)
+	keys := make(seriesKeys, len(names))
+	for i := range names {
+		keys[i] = AppendSeriesKey(nil, names[i], tagsSlice[i])
+	}
+	sort.Sort(keys)
+
+	block := EncodeSeriesKeyBlock(nil, keys, 8)
+	r, err := NewSeriesKeyBlockReader(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{0, 1, 7, 8, 9, len(keys) / 2, len(keys) - 1} {
+		it := r.Iterator()
+		if !it.Seek(keys[i]) {
+			t.Fatalf("Seek(%d): expected a match", i)
+		}
+		if CompareSeriesKeys(it.Key(), keys[i]) != 0 {
+			t.Fatalf("Seek(%d): unexpected key", i)
+		}
+	}
+
+	// Seeking past the last key should fail.
+	it := r.Iterator()
+	if it.Seek(makeKey("zzzzzzzzzz_past_the_end")) {
+		t.Fatal("Seek past end: expected no match")
+	}
+}
+
+// TestSeriesKeyBlockIterator_Seek_Empty confirms Seek on a block built from
+// an empty key list returns false instead of panicking: EncodeSeriesKeyBlock
+// and NewSeriesKeyBlockReader both accept/produce this state without error,
+// so the empty restart array has to be handled rather than indexed blindly.
+func TestSeriesKeyBlockIterator_Seek_Empty(t *testing.T) {
+	block := EncodeSeriesKeyBlock(nil, nil, 8)
+	r, err := NewSeriesKeyBlockReader(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := r.Iterator()
+	if it.Seek(makeKey("cpu")) {
+		t.Fatal("expected no match in an empty block")
+	}
+}
+
+// TestSeriesKeyBlock_CompressesBytesSectionOnly prefix-compresses adjacent
+// keys whose tag *value* lengths differ by a byte (the common host9 ->
+// host10 case), a change that perturbs the header ahead of the name+tags
+// bytes section, and checks that every key round-trips byte for byte and
+// that the block comes out smaller than the raw keys. It does not check how
+// many bytes each individual entry shares with the previous one.
+func TestSeriesKeyBlock_CompressesBytesSectionOnly(t *testing.T) {
+	var keys seriesKeys
+	for i := 0; i < 20; i++ {
+		n, tags := models.ParseKeyBytes([]byte(fmt.Sprintf("cpu,host=host%d", i)))
+		keys = append(keys, AppendSeriesKey(nil, n, tags))
+	}
+	sort.Sort(keys)
+
+	block := EncodeSeriesKeyBlock(nil, keys, DefaultSeriesKeyBlockRestartInterval)
+	r, err := NewSeriesKeyBlockReader(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := r.Iterator()
+	for i, key := range keys {
+		if !it.Next() {
+			t.Fatalf("unexpected end of block at entry %d", i)
+		}
+		if !bytes.Equal(it.Key(), key) {
+			t.Fatalf("entry %d: got %q, exp %q", i, it.Key(), key)
+		}
+	}
+
+	var rawSize int
+	for _, key := range keys {
+		rawSize += len(key)
+	}
+	if len(block) >= rawSize {
+		t.Fatalf("block (%d bytes) did not compress below raw keys (%d bytes)", len(block), rawSize)
+	}
+}
+
+func TestSeriesKeySegment_RoundTrip_1M(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping 1M-key round trip in -short mode")
+	}
+
+	const n = 1_000_000
+	names, tagsSlice := generateSeries(n/10, 10)
+	keys := make(seriesKeys, len(names))
+	for i := range names {
+		keys[i] = AppendSeriesKey(nil, names[i], tagsSlice[i])
+	}
+
+	rand.Seed(2)
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	sort.Sort(keys)
+
+	segment := EncodeSeriesKeySegment(keys, DefaultSeriesKeyBlockSize, DefaultSeriesKeyBlockRestartInterval)
+
+	r, err := NewSeriesKeySegmentReader(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("unexpected key count: got %d, exp %d", len(got), len(keys))
+	}
+	for i := range keys {
+		if CompareSeriesKeys(got[i], keys[i]) != 0 {
+			t.Fatalf("key %d diverged after round trip", i)
+		}
+	}
+
+	for _, i := range []int{0, len(keys) / 4, len(keys) / 2, len(keys) - 1} {
+		it, ok, err := r.Seek(keys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("Seek(%d): expected a match", i)
+		}
+		if CompareSeriesKeys(it.Key(), keys[i]) != 0 {
+			t.Fatalf("Seek(%d): unexpected key", i)
+		}
+	}
+}
+
+func BenchmarkSeriesKeySegment_Seek(b *testing.B) {
+	names, tagsSlice := generateSeries(1000, 100, 10)
+	keys := make(seriesKeys, len(names))
+	for i := range names {
+		keys[i] = AppendSeriesKey(nil, names[i], tagsSlice[i])
+	}
+	sort.Sort(keys)
+
+	segment := EncodeSeriesKeySegment(keys, DefaultSeriesKeyBlockSize, DefaultSeriesKeyBlockRestartInterval)
+	r, err := NewSeriesKeySegmentReader(segment)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		target := keys[i%len(keys)]
+		if _, ok, err := r.Seek(target); err != nil || !ok {
+			b.Fatalf("Seek: ok=%v err=%v", ok, err)
+		}
+	}
+}
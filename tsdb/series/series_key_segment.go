@@ -0,0 +1,177 @@
+package series
+
+import "encoding/binary"
+
+// DefaultSeriesKeyBlockSize is the default number of keys grouped into a
+// single prefix-compressed block by EncodeSeriesKeySegment.
+const DefaultSeriesKeyBlockSize = 256
+
+// EncodeSeriesKeySegment groups sorted keys into blockSize-sized
+// prefix-compressed blocks (EncodeSeriesKeyBlock), followed by a trailing
+// index of each block's (offset, length, first key) so a reader can binary
+// search for the block holding a target key before decompressing it.
+//
+// keys must already be sorted by CompareSeriesKeys. If blockSize <= 0,
+// DefaultSeriesKeyBlockSize is used.
+func EncodeSeriesKeySegment(keys [][]byte, blockSize, restartInterval int) []byte {
+	if blockSize <= 0 {
+		blockSize = DefaultSeriesKeyBlockSize
+	}
+
+	type indexEntry struct {
+		offset uint32
+		length uint32
+		key    []byte
+	}
+
+	var out []byte
+	var index []indexEntry
+
+	for start := 0; start < len(keys); start += blockSize {
+		end := start + blockSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		offset := len(out)
+		out = EncodeSeriesKeyBlock(out, keys[start:end], restartInterval)
+		index = append(index, indexEntry{
+			offset: uint32(offset),
+			length: uint32(len(out) - offset),
+			key:    keys[start],
+		})
+	}
+
+	indexOffset := len(out)
+	var varintBuf [binary.MaxVarintLen64]byte
+	for _, e := range index {
+		out = appendUint32(out, e.offset)
+		out = appendUint32(out, e.length)
+		n := binary.PutUvarint(varintBuf[:], uint64(len(e.key)))
+		out = append(out, varintBuf[:n]...)
+		out = append(out, e.key...)
+	}
+	out = appendUint32(out, uint32(indexOffset))
+	out = appendUint32(out, uint32(len(index)))
+
+	return out
+}
+
+// SeriesKeySegmentReader reads a segment produced by EncodeSeriesKeySegment,
+// decoding blocks on demand rather than up front.
+type SeriesKeySegmentReader struct {
+	data  []byte
+	index []seriesKeySegmentIndexEntry
+}
+
+type seriesKeySegmentIndexEntry struct {
+	offset uint32
+	length uint32
+	key    []byte
+}
+
+// NewSeriesKeySegmentReader parses the index of data and returns a reader
+// over its blocks.
+func NewSeriesKeySegmentReader(data []byte) (*SeriesKeySegmentReader, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidSeriesKeyBlock
+	}
+
+	blockCount := binary.BigEndian.Uint32(data[len(data)-4:])
+	indexOffset := binary.BigEndian.Uint32(data[len(data)-8 : len(data)-4])
+	if int(indexOffset) > len(data)-8 {
+		return nil, ErrInvalidSeriesKeyBlock
+	}
+
+	index := make([]seriesKeySegmentIndexEntry, blockCount)
+	pos := int(indexOffset)
+	for i := range index {
+		offset := binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+		length := binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+		keyLen, n := binary.Uvarint(data[pos:])
+		pos += n
+		index[i] = seriesKeySegmentIndexEntry{
+			offset: offset,
+			length: length,
+			key:    data[pos : pos+int(keyLen)],
+		}
+		pos += int(keyLen)
+	}
+
+	return &SeriesKeySegmentReader{data: data, index: index}, nil
+}
+
+// Len returns the number of blocks in the segment.
+func (r *SeriesKeySegmentReader) Len() int { return len(r.index) }
+
+// block returns a reader for the i'th block.
+func (r *SeriesKeySegmentReader) block(i int) (*SeriesKeyBlockReader, error) {
+	e := r.index[i]
+	return NewSeriesKeyBlockReader(r.data[e.offset : e.offset+e.length])
+}
+
+// Seek returns an iterator over the block that may contain target,
+// positioned at the first key >= target, or nil if target is past the end
+// of the segment.
+func (r *SeriesKeySegmentReader) Seek(target []byte) (*SeriesKeyBlockIterator, bool, error) {
+	if len(r.index) == 0 {
+		return nil, false, nil
+	}
+
+	// Binary search for the last block whose first key is <= target.
+	lo, hi := 0, len(r.index)-1
+	idx := 0
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		if CompareSeriesKeys(r.index[mid].key, target) <= 0 {
+			idx = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	block, err := r.block(idx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	it := block.Iterator()
+	if it.Seek(target) {
+		return it, true, nil
+	}
+
+	// target is past the last key of this block; it may still be the
+	// first key of the next one.
+	if idx+1 < len(r.index) {
+		block, err := r.block(idx + 1)
+		if err != nil {
+			return nil, false, err
+		}
+		it := block.Iterator()
+		return it, it.Next(), nil
+	}
+
+	return nil, false, nil
+}
+
+// All decodes every key in the segment, in order. It is intended for tests
+// and small-scale tooling, not the compaction hot path.
+func (r *SeriesKeySegmentReader) All() ([][]byte, error) {
+	var keys [][]byte
+	for i := range r.index {
+		block, err := r.block(i)
+		if err != nil {
+			return nil, err
+		}
+		it := block.Iterator()
+		for it.Next() {
+			key := make([]byte, len(it.Key()))
+			copy(key, it.Key())
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,188 @@
+package series
+
+import (
+	"encoding/binary"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// seriesKeyVersion2 is the leading byte of a V2-encoded series key. V1 keys
+// carry no marker and begin directly with the big-endian offsets_section_size
+// written by AppendSeriesKey, which would collide with this sentinel once a
+// series has enough tags to push offsets_section_size into [0xFF00, 0xFFFF].
+// AppendSeriesKey enforces MaxSeriesKeyV1Tags to rule that out, so a single
+// leading byte is enough to tell the two formats apart without threading a
+// format version down from the partition/segment layer.
+const seriesKeyVersion2 = 0xFF
+
+// MaxSeriesKeyV1Tags is the most tags AppendSeriesKey will encode. Above it,
+// offsets_section_size's high byte would equal seriesKeyVersion2, making the
+// V1 key indistinguishable from a V2 one to GetSeriesKeyTagN/CompareSeriesKeys.
+const MaxSeriesKeyV1Tags = 16319 // 2 + 4*16319 = 65278, just under 0xFF00
+
+// AppendSeriesKeyV2 serializes name and tags using the same offsets/bytes
+// section layout as AppendSeriesKey, but replaces every fixed uint16 length
+// field inside the offsets section (name length, tag key/value lengths)
+// with a varint. The offsets_section_size and bytes_section_size fields
+// themselves stay fixed-width uint16s, exactly as in AppendSeriesKey, so
+// CompareSeriesKeys can still jump straight from the front of the key to the
+// bytes section without decoding the offsets section. A leading
+// seriesKeyVersion2 byte distinguishes the layout from AppendSeriesKey's.
+//
+// For a typical series (short tag keys/values, a handful of tags) this
+// shrinks the length metadata from 2 bytes per field to 1.
+func AppendSeriesKeyV2(dst []byte, name []byte, tags models.Tags) []byte {
+	ofssz := seriesKeyOffsetsSizeV2(name, tags)
+	bytsz := SeriesKeyBytesSize(name, tags)
+
+	size := 1 + 2 + ofssz + 2 + bytsz // version + ofssz + offsets + bytsz + bytes
+	var out []byte
+	if dst == nil {
+		dst = make([]byte, size)
+		out = dst
+	} else {
+		if cap(dst)-len(dst) < size {
+			tmp := make([]byte, len(dst), len(dst)+size)
+			copy(tmp, dst)
+			dst = tmp
+		}
+		dst = dst[:len(dst)+size]
+		out = dst[len(dst)-size:]
+	}
+
+	out[0] = seriesKeyVersion2
+	opos := 1
+
+	PutUint16(out, opos, uint16(ofssz))
+	opos += 2
+	bpos := opos + ofssz
+
+	opos += binary.PutUvarint(out[opos:], uint64(len(name)))
+
+	PutUint16(out, bpos, uint16(bytsz))
+	bpos += 2
+	copy(out[bpos:bpos+len(name)], name)
+	bpos += len(name)
+
+	for i := range tags {
+		tag := &tags[i]
+
+		opos += binary.PutUvarint(out[opos:], uint64(len(tag.Key)))
+		copy(out[bpos:bpos+len(tag.Key)], tag.Key)
+		bpos += len(tag.Key)
+
+		opos += binary.PutUvarint(out[opos:], uint64(len(tag.Value)))
+		copy(out[bpos:bpos+len(tag.Value)], tag.Value)
+		bpos += len(tag.Value)
+	}
+
+	return dst
+}
+
+// seriesKeyOffsetsSizeV2 returns the number of bytes the varint-encoded
+// offsets section occupies for name/tags: one varint for the name length
+// plus two varints (key length, value length) per tag.
+func seriesKeyOffsetsSizeV2(name []byte, tags models.Tags) int {
+	n := sovSeriesKey(uint64(len(name)))
+	for i := range tags {
+		n += sovSeriesKey(uint64(len(tags[i].Key)))
+		n += sovSeriesKey(uint64(len(tags[i].Value)))
+	}
+	return n
+}
+
+// sovSeriesKey returns the number of bytes binary.PutUvarint would write for x.
+func sovSeriesKey(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			return n
+		}
+	}
+}
+
+// ParseSeriesKeyV2 extracts the name & tags from a V2-encoded series key.
+func ParseSeriesKeyV2(data []byte) (name []byte, _ models.Tags) {
+	return ParseSeriesKeyTagsV2(data, nil)
+}
+
+// ParseSeriesKeyTagsV2 extracts the name & tags from a V2-encoded series
+// key, using the tags slice if there is space available.
+func ParseSeriesKeyTagsV2(data []byte, tags models.Tags) (name []byte, _ models.Tags) {
+	ofsN := GetUint16(data, 1)
+	opos := 3
+	oend := 3 + ofsN
+	bpos := oend + 2
+
+	nlen, n := binary.Uvarint(data[opos:])
+	opos += n
+
+	name = data[bpos : bpos+int(nlen)]
+	bpos += int(nlen)
+
+	tags = tags[:0]
+	for opos < oend {
+		klen, n := binary.Uvarint(data[opos:])
+		opos += n
+		vlen, n := binary.Uvarint(data[opos:])
+		opos += n
+
+		tags = append(tags, models.Tag{
+			Key:   data[bpos : bpos+int(klen)],
+			Value: data[bpos+int(klen) : bpos+int(klen)+int(vlen)],
+		})
+		bpos += int(klen) + int(vlen)
+	}
+
+	return name, tags
+}
+
+// getSeriesKeyTagNV2 returns the number of tags encoded in a V2 series key.
+// Unlike V1, the per-tag width isn't constant, so this walks the (small)
+// offsets section rather than computing the count from its byte length.
+func getSeriesKeyTagNV2(data []byte) int {
+	ofsN := GetUint16(data, 1)
+	opos := 3
+	oend := 3 + ofsN
+
+	_, n := binary.Uvarint(data[opos:]) // name length
+	opos += n
+
+	tagN := 0
+	for opos < oend {
+		_, n := binary.Uvarint(data[opos:])
+		opos += n
+		_, n = binary.Uvarint(data[opos:])
+		opos += n
+		tagN++
+	}
+	return tagN
+}
+
+// seriesKeyBytesSection returns the name+tags byte blob a series key's
+// offsets point at, regardless of whether the key is V1 or V2 encoded. This
+// is the slice CompareSeriesKeys orders on.
+func seriesKeyBytesSection(data []byte) []byte {
+	if data[0] == seriesKeyVersion2 {
+		ofsN := GetUint16(data, 1)
+		pos := 3 + ofsN
+		sz := GetUint16(data, pos)
+		pos += 2
+		return data[pos : pos+sz]
+	}
+
+	ofsN := GetUint16(data, 0)
+	pos := ofsN + 2
+	sz := GetUint16(data, pos)
+	pos += 2
+	return data[pos : pos+sz]
+}
+
+// ConvertSeriesKeyV1ToV2 re-encodes a V1 series key (as produced by
+// AppendSeriesKey) into V2 form, appending it to dst. This is the rewrite a
+// compactor would apply to migrate a partition's keys from V1 to V2.
+func ConvertSeriesKeyV1ToV2(dst []byte, v1Key []byte) []byte {
+	name, tags := ParseSeriesKey(v1Key)
+	return AppendSeriesKeyV2(dst, name, tags)
+}